@@ -11,7 +11,9 @@ package getty
 
 import (
 	// "errors"
+	"io"
 	"net"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -66,6 +68,15 @@ type gettyConn struct {
 	wDeadline     time.Duration
 	local         string // local address
 	peer          string // peer address
+	closing       int32  // set to 1 once a non-temporary read/write error has been seen
+}
+
+func (this *gettyConn) setClosing() {
+	atomic.StoreInt32(&this.closing, 1)
+}
+
+func (this *gettyConn) isClosing() bool {
+	return atomic.LoadInt32(&this.closing) == 1
 }
 
 func (this *gettyConn) incReadPkgCount() {
@@ -123,7 +134,9 @@ func (this *gettyConn) setWriteDeadline(wDeadline time.Duration) {
 
 type gettyTCPConn struct {
 	gettyConn
-	conn net.Conn
+	rlock sync.Mutex
+	wlock sync.Mutex
+	conn  net.Conn
 }
 
 // create gettyTCPConn
@@ -156,9 +169,22 @@ func (this *gettyTCPConn) read(p []byte) (int, error) {
 	//	return 0, ErrInvalidConnection
 	// }
 
-	// atomic.AddUint32(&this.readCount, 1)
+	if this.isClosing() {
+		return 0, io.EOF
+	}
+
+	this.rlock.Lock()
+	defer this.rlock.Unlock()
+
+	if rDeadline := this.readDeadline(); rDeadline > 0 {
+		this.conn.SetReadDeadline(time.Now().Add(rDeadline))
+	}
 	l, e := this.conn.Read(p)
 	atomic.AddUint32(&this.readCount, uint32(l))
+	if e != nil && !isTemporary(e) {
+		this.setClosing()
+	}
+
 	return l, e
 }
 
@@ -168,9 +194,22 @@ func (this *gettyTCPConn) write(p []byte) error {
 	//	return 0, ErrInvalidConnection
 	// }
 
-	// atomic.AddUint32(&this.writeCount, 1)
+	if this.isClosing() {
+		return io.EOF
+	}
+
+	this.wlock.Lock()
+	defer this.wlock.Unlock()
+
+	if wDeadline := this.writeDeadline(); wDeadline > 0 {
+		this.conn.SetWriteDeadline(time.Now().Add(wDeadline))
+	}
 	atomic.AddUint32(&this.writeCount, (uint32)(len(p)))
 	_, err := this.conn.Write(p)
+	if err != nil && !isTemporary(err) {
+		this.setClosing()
+	}
+
 	return err
 }
 
@@ -180,20 +219,36 @@ func (this *gettyTCPConn) close(waitSec int) {
 	// tcpConn.SetLinger(0)
 	// }
 
+	this.setClosing()
 	if this.conn != nil {
-		this.conn.(*net.TCPConn).SetLinger(waitSec)
+		// @conn is a *tls.Conn rather than a *net.TCPConn when this wraps a
+		// TLS-dialed connection, so only set linger when it's the raw socket.
+		if tcpConn, ok := this.conn.(*net.TCPConn); ok {
+			tcpConn.SetLinger(waitSec)
+		}
 		this.conn.Close()
 		this.conn = nil
 	}
 }
 
+// isTemporary reports whether @err is a recoverable, transient net.Error. A
+// non-temporary error means the underlying connection is no longer usable.
+func isTemporary(err error) bool {
+	if e, ok := err.(net.Error); ok {
+		return e.Temporary()
+	}
+	return false
+}
+
 /////////////////////////////////////////
 // getty websocket connection
 /////////////////////////////////////////
 
 type gettyWSConn struct {
 	gettyConn
-	conn *websocket.Conn
+	rlock sync.Mutex
+	wlock sync.Mutex
+	conn  *websocket.Conn
 }
 
 // create websocket connection
@@ -225,7 +280,16 @@ func newGettyWSConn(conn *websocket.Conn) *gettyWSConn {
 }
 
 func (this *gettyWSConn) handlePing(message string) error {
-	err := this.conn.WriteMessage(websocket.PongMessage, []byte(message))
+	// gorilla invokes ping/pong handlers from the reader goroutine (inside
+	// ReadMessage/NextReader), concurrently with write()/writePing()/close(),
+	// so the reply can't go through WriteMessage under wlock like those do --
+	// WriteControl is the one method gorilla documents as safe to call
+	// concurrently with the other writers.
+	var deadline time.Time
+	if wDeadline := this.writeDeadline(); wDeadline > 0 {
+		deadline = time.Now().Add(wDeadline)
+	}
+	err := this.conn.WriteControl(websocket.PongMessage, []byte(message), deadline)
 	if err == websocket.ErrCloseSent {
 		err = nil
 	} else if e, ok := err.(net.Error); ok && e.Temporary() {
@@ -245,7 +309,16 @@ func (this *gettyWSConn) handlePong(string) error {
 
 // websocket connection read
 func (this *gettyWSConn) read() ([]byte, error) {
-	// this.conn.SetReadDeadline(time.Now().Add(this.rDeadline))
+	if this.isClosing() {
+		return nil, io.EOF
+	}
+
+	this.rlock.Lock()
+	defer this.rlock.Unlock()
+
+	if rDeadline := this.readDeadline(); rDeadline > 0 {
+		this.conn.SetReadDeadline(time.Now().Add(rDeadline))
+	}
 	_, b, e := this.conn.ReadMessage() // the first return value is message type.
 	if e == nil {
 		// atomic.AddUint32(&this.readCount, (uint32)(l))
@@ -254,6 +327,9 @@ func (this *gettyWSConn) read() ([]byte, error) {
 		if websocket.IsUnexpectedCloseError(e, websocket.CloseGoingAway) {
 			log.Warn("websocket unexpected close error: %v", e)
 		}
+		if !isTemporary(e) {
+			this.setClosing()
+		}
 	}
 
 	return b, e
@@ -261,19 +337,46 @@ func (this *gettyWSConn) read() ([]byte, error) {
 
 // websocket connection write
 func (this *gettyWSConn) write(p []byte) error {
-	// atomic.AddUint32(&this.writeCount, 1)
+	if this.isClosing() {
+		return io.EOF
+	}
+
+	// gorilla/websocket.Conn.WriteMessage is not goroutine-safe, so concurrent
+	// writers must be serialized or frames will get corrupted.
+	this.wlock.Lock()
+	defer this.wlock.Unlock()
+
 	atomic.AddUint32(&this.writeCount, (uint32)(len(p)))
-	// this.conn.SetWriteDeadline(time.Now().Add(this.wDeadline))
-	return this.conn.WriteMessage(websocket.BinaryMessage, p)
+	if wDeadline := this.writeDeadline(); wDeadline > 0 {
+		this.conn.SetWriteDeadline(time.Now().Add(wDeadline))
+	}
+	err := this.conn.WriteMessage(websocket.BinaryMessage, p)
+	if err != nil && !isTemporary(err) {
+		this.setClosing()
+	}
+
+	return err
 }
 
 func (this *gettyWSConn) writePing() error {
+	this.wlock.Lock()
+	defer this.wlock.Unlock()
+
 	return this.conn.WriteMessage(websocket.PingMessage, []byte{})
 }
 
 // close websocket connection
 func (this *gettyWSConn) close(waitSec int) {
+	this.setClosing()
+
+	this.wlock.Lock()
 	this.conn.WriteMessage(websocket.CloseMessage, []byte("bye-bye!!!"))
-	this.conn.UnderlyingConn().(*net.TCPConn).SetLinger(waitSec)
+	this.wlock.Unlock()
+
+	// UnderlyingConn() is a *tls.Conn for a wss:// connection, so only set
+	// linger when it is actually the raw *net.TCPConn.
+	if tcpConn, ok := this.conn.UnderlyingConn().(*net.TCPConn); ok {
+		tcpConn.SetLinger(waitSec)
+	}
 	this.conn.Close()
 }
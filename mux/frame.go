@@ -0,0 +1,64 @@
+/******************************************************
+# DESC       : wire frame format for the getty session multiplexer
+# MAINTAINER : Alex Stocks
+# LICENCE    : Apache License 2.0
+# EMAIL      : alexstocks@foxmail.com
+# MOD        : 2016-11-12 21:05
+# FILE       : frame.go
+******************************************************/
+
+package mux
+
+import (
+	"encoding/binary"
+)
+
+type frameType uint8
+
+const (
+	frameSYN frameType = iota
+	frameDATA
+	frameFIN
+	frameWindowUpdate
+	framePING
+)
+
+// frameHeaderSize is 1 byte of Type + 4 bytes of StreamID + 4 bytes of Length.
+const frameHeaderSize = 9
+
+// frameHeader is the fixed-size header that precedes every frame's payload
+// on the wire: Type, StreamID and Length in that order (big-endian), with
+// Length bytes of Payload following immediately after the header bytes.
+type frameHeader struct {
+	Type     frameType
+	StreamID uint32
+	Length   uint32
+}
+
+func (h frameHeader) encode() []byte {
+	buf := make([]byte, frameHeaderSize)
+	buf[0] = byte(h.Type)
+	binary.BigEndian.PutUint32(buf[1:5], h.StreamID)
+	binary.BigEndian.PutUint32(buf[5:9], h.Length)
+
+	return buf
+}
+
+func decodeFrameHeader(buf []byte) frameHeader {
+	return frameHeader{
+		Type:     frameType(buf[0]),
+		StreamID: binary.BigEndian.Uint32(buf[1:5]),
+		Length:   binary.BigEndian.Uint32(buf[5:9]),
+	}
+}
+
+func encodeWindowUpdate(n uint32) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, n)
+
+	return buf
+}
+
+func decodeWindowUpdate(buf []byte) uint32 {
+	return binary.BigEndian.Uint32(buf)
+}
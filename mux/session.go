@@ -0,0 +1,274 @@
+/******************************************************
+# DESC       : multiplexed session of virtual streams over a single net.Conn
+# MAINTAINER : Alex Stocks
+# LICENCE    : Apache License 2.0
+# EMAIL      : alexstocks@foxmail.com
+# MOD        : 2016-11-12 21:05
+# FILE       : session.go
+******************************************************/
+
+// Package mux layers many logical, flow-controlled virtual streams over a
+// single physical net.Conn -- e.g. getty's streaming websocket adapter
+// (wsStreamConn) or a raw TCP/TLS connection -- similar to yamux/smux.
+// gettyTCPConn and gettyWSConn themselves do not implement net.Conn and
+// cannot be passed to NewSession directly. It lets a client amortize the
+// TCP/TLS/WS handshake cost across many concurrent RPCs on one physical
+// connection.
+package mux
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+var (
+	// ErrSessionClosed is returned by Session methods once the session has
+	// been shut down.
+	ErrSessionClosed = errors.New("mux: session has been closed")
+)
+
+// maxFrameLength bounds a single frame's declared payload length so that a
+// corrupt or malicious Length field can't force an arbitrarily large
+// allocation; no well-behaved peer ever exceeds one stream's flow window.
+const maxFrameLength = defaultStreamWindowSize
+
+// Session multiplexes many Stream connections over a single underlying
+// net.Conn. A single reader goroutine demuxes incoming frames into their
+// stream's buffer so that codecs written against net.Conn stream semantics
+// can run unchanged on top of a Stream.
+type Session struct {
+	conn     net.Conn
+	isClient bool
+
+	mutex     sync.Mutex
+	nextID    uint32
+	streams   map[uint32]*Stream
+	acceptCh  chan *Stream
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	writeLock sync.Mutex // serializes the header+payload pair written per frame
+}
+
+// NewSession wraps @conn as a mux.Session and starts its reader goroutine.
+// @isClient selects which half of the uint32 stream ID space this side
+// allocates from (odd IDs for the client, even IDs for the server) so that
+// both ends can open streams without colliding.
+func NewSession(conn net.Conn, isClient bool) *Session {
+	session := &Session{
+		conn:     conn,
+		isClient: isClient,
+		streams:  make(map[uint32]*Stream),
+		acceptCh: make(chan *Stream, 64),
+		closed:   make(chan struct{}),
+	}
+	if isClient {
+		session.nextID = 1
+	} else {
+		session.nextID = 2
+	}
+
+	go session.recvLoop()
+
+	return session
+}
+
+func (this *Session) newStreamID() uint32 {
+	this.mutex.Lock()
+	id := this.nextID
+	this.nextID += 2
+	this.mutex.Unlock()
+
+	return id
+}
+
+// OpenStream opens a new logical stream by sending a SYN frame and returns it
+// right away; the accompanying Stream is usable for Write immediately and
+// for Read as soon as the peer's DATA frames start arriving.
+func (this *Session) OpenStream() (*Stream, error) {
+	select {
+	case <-this.closed:
+		return nil, ErrSessionClosed
+	default:
+	}
+
+	id := this.newStreamID()
+	stream := newStream(id, this)
+
+	this.mutex.Lock()
+	this.streams[id] = stream
+	this.mutex.Unlock()
+
+	if err := this.writeFrame(frameSYN, id, nil); err != nil {
+		this.mutex.Lock()
+		delete(this.streams, id)
+		this.mutex.Unlock()
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// AcceptStream blocks until the peer opens a new stream or the session is
+// closed.
+func (this *Session) AcceptStream() (*Stream, error) {
+	select {
+	case stream := <-this.acceptCh:
+		return stream, nil
+	case <-this.closed:
+		return nil, ErrSessionClosed
+	}
+}
+
+// Ping sends a keepalive PING frame to the peer.
+func (this *Session) Ping() error {
+	return this.writeFrame(framePING, 0, nil)
+}
+
+// Close tears down every open stream and the underlying connection.
+func (this *Session) Close() error {
+	this.closeOnce.Do(func() {
+		close(this.closed)
+
+		this.mutex.Lock()
+		streams := this.streams
+		this.streams = make(map[uint32]*Stream)
+		this.mutex.Unlock()
+
+		for _, stream := range streams {
+			stream.closeWithError(ErrSessionClosed)
+		}
+	})
+
+	return this.conn.Close()
+}
+
+// writeFrame writes a header+payload pair as one unit. The lock keeps frames
+// from different streams from interleaving on the wire, since a header only
+// makes sense immediately followed by its own payload.
+func (this *Session) writeFrame(t frameType, streamID uint32, payload []byte) error {
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+
+	h := frameHeader{Type: t, StreamID: streamID, Length: uint32(len(payload))}
+	if _, err := this.conn.Write(h.encode()); err != nil {
+		return err
+	}
+	if len(payload) > 0 {
+		if _, err := this.conn.Write(payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recvLoop is the session's single reader goroutine: it demuxes frames off
+// the wire into their owning Stream until the connection errors out, at
+// which point the whole session is closed.
+func (this *Session) recvLoop() {
+	defer this.Close()
+
+	header := make([]byte, frameHeaderSize)
+	for {
+		if _, err := io.ReadFull(this.conn, header); err != nil {
+			return
+		}
+		h := decodeFrameHeader(header)
+		if h.Length > maxFrameLength {
+			return
+		}
+
+		var payload []byte
+		if h.Length > 0 {
+			payload = make([]byte, h.Length)
+			if _, err := io.ReadFull(this.conn, payload); err != nil {
+				return
+			}
+		}
+
+		switch h.Type {
+		case frameSYN:
+			this.handleSYN(h.StreamID)
+		case frameDATA:
+			this.handleData(h.StreamID, payload)
+		case frameFIN:
+			this.handleFIN(h.StreamID)
+		case frameWindowUpdate:
+			this.handleWindowUpdate(h.StreamID, payload)
+		case framePING:
+			// no-op: the frame's arrival alone is the keepalive signal
+		}
+	}
+}
+
+func (this *Session) getStream(id uint32) *Stream {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.streams[id]
+}
+
+// handleSYN admits a new incoming stream unless the un-accepted backlog
+// (bounded by acceptCh's capacity) is already full, in which case the SYN is
+// rejected with a FIN instead of being queued. This keeps a peer that opens
+// streams faster than the local app calls AcceptStream from growing the
+// streams map and goroutine count without bound, and keeps delivery to
+// AcceptStream in the order SYNs were actually received.
+func (this *Session) handleSYN(id uint32) {
+	this.mutex.Lock()
+	if _, ok := this.streams[id]; ok {
+		this.mutex.Unlock()
+		return
+	}
+	stream := newStream(id, this)
+	this.streams[id] = stream
+	this.mutex.Unlock()
+
+	select {
+	case this.acceptCh <- stream:
+		return
+	default:
+	}
+
+	this.mutex.Lock()
+	delete(this.streams, id)
+	this.mutex.Unlock()
+	this.writeFrame(frameFIN, id, nil)
+}
+
+func (this *Session) handleData(id uint32, payload []byte) {
+	stream := this.getStream(id)
+	if stream == nil {
+		return
+	}
+	if !stream.pushData(payload) {
+		// the peer wrote past the window it was granted; the session can no
+		// longer trust the framing, so tear the whole thing down.
+		this.Close()
+	}
+}
+
+func (this *Session) handleFIN(id uint32) {
+	this.mutex.Lock()
+	stream, ok := this.streams[id]
+	if ok {
+		delete(this.streams, id)
+	}
+	this.mutex.Unlock()
+
+	if ok {
+		stream.closeWithError(io.EOF)
+	}
+}
+
+func (this *Session) handleWindowUpdate(id uint32, payload []byte) {
+	if len(payload) < 4 {
+		return
+	}
+	if stream := this.getStream(id); stream != nil {
+		stream.grantWindow(decodeWindowUpdate(payload))
+	}
+}
@@ -0,0 +1,98 @@
+/******************************************************
+# DESC       : tests for the mux session/stream flow control
+# MAINTAINER : Alex Stocks
+# LICENCE    : Apache License 2.0
+# EMAIL      : alexstocks@foxmail.com
+# MOD        : 2016-11-19 10:02
+# FILE       : session_test.go
+******************************************************/
+
+package mux
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStreamPushDataRejectsOverWindow(t *testing.T) {
+	stream := newStream(1, &Session{})
+
+	if ok := stream.pushData(make([]byte, defaultStreamWindowSize)); !ok {
+		t.Fatalf("pushData should accept exactly a full window's worth of bytes")
+	}
+	if ok := stream.pushData([]byte{0}); ok {
+		t.Fatalf("pushData should reject a byte once the recv window is full")
+	}
+}
+
+func TestSessionStreamWindowReplenishment(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	clientSession := NewSession(clientConn, true)
+	serverSession := NewSession(serverConn, false)
+	defer clientSession.Close()
+	defer serverSession.Close()
+
+	clientStream, err := clientSession.OpenStream()
+	if err != nil {
+		t.Fatalf("OpenStream() = error:%s", err)
+	}
+
+	acceptCh := make(chan *Stream, 1)
+	go func() {
+		stream, err := serverSession.AcceptStream()
+		if err != nil {
+			t.Errorf("AcceptStream() = error:%s", err)
+			return
+		}
+		acceptCh <- stream
+	}()
+
+	var serverStream *Stream
+	select {
+	case serverStream = <-acceptCh:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for AcceptStream")
+	}
+
+	// write more than a single window's worth of data: this can only succeed
+	// if the server's stream sends WINDOW_UPDATE frames back as it reads, so
+	// it exercises the "sliding window" part of the design, not just the
+	// initial allowance.
+	total := defaultStreamWindowSize + defaultStreamWindowSize/4
+	payload := make([]byte, total)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	writeDone := make(chan error, 1)
+	go func() {
+		_, err := clientStream.Write(payload)
+		writeDone <- err
+	}()
+
+	received := 0
+	buf := make([]byte, 4096)
+	deadline := time.After(3 * time.Second)
+	for received < total {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out after reading %d/%d bytes -- window was not replenished", received, total)
+		default:
+		}
+		n, err := serverStream.Read(buf)
+		if err != nil {
+			t.Fatalf("Read() = error:%s", err)
+		}
+		received += n
+	}
+
+	select {
+	case err := <-writeDone:
+		if err != nil {
+			t.Fatalf("Write() = error:%s", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for Write to return")
+	}
+}
@@ -0,0 +1,179 @@
+/******************************************************
+# DESC       : a single virtual stream multiplexed over a mux.Session
+# MAINTAINER : Alex Stocks
+# LICENCE    : Apache License 2.0
+# EMAIL      : alexstocks@foxmail.com
+# MOD        : 2016-11-12 21:05
+# FILE       : stream.go
+******************************************************/
+
+package mux
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// defaultStreamWindowSize is the sliding-window flow-control limit applied
+// to every stream, in both directions, as called for by the mux design.
+const defaultStreamWindowSize = 256 * 1024
+
+// ErrDeadlineNotSupported is returned by a Stream's deadline setters: unlike
+// the physical gettyConn below it, a virtual stream has no per-message
+// timeout mechanism of its own.
+var ErrDeadlineNotSupported = errors.New("mux: stream does not support deadlines")
+
+// Stream is one virtual, flow-controlled connection multiplexed over a
+// Session. It implements net.Conn so existing getty codecs can run over it
+// unchanged.
+type Stream struct {
+	id      uint32
+	session *Session
+
+	mutex      sync.Mutex
+	cond       *sync.Cond
+	recvBuf    []byte
+	recvAcked  uint32 // bytes read by the caller but not yet acknowledged via WINDOW_UPDATE
+	sendWindow uint32
+	closed     bool
+	closeErr   error
+}
+
+func newStream(id uint32, session *Session) *Stream {
+	stream := &Stream{
+		id:         id,
+		session:    session,
+		sendWindow: defaultStreamWindowSize,
+	}
+	stream.cond = sync.NewCond(&stream.mutex)
+
+	return stream
+}
+
+// pushData appends an incoming DATA frame's payload to the stream's receive
+// buffer. It reports false, without buffering anything, when the peer has
+// sent more than the advertised recv window's worth of un-read bytes -- the
+// caller must treat that as a protocol violation, since a well-behaved peer
+// never writes past the window it was granted.
+func (this *Stream) pushData(p []byte) bool {
+	this.mutex.Lock()
+	if uint32(len(this.recvBuf)+len(p)) > defaultStreamWindowSize {
+		this.mutex.Unlock()
+		return false
+	}
+	this.recvBuf = append(this.recvBuf, p...)
+	this.mutex.Unlock()
+
+	this.cond.Broadcast()
+	return true
+}
+
+func (this *Stream) grantWindow(n uint32) {
+	this.mutex.Lock()
+	this.sendWindow += n
+	this.mutex.Unlock()
+
+	this.cond.Broadcast()
+}
+
+func (this *Stream) closeWithError(err error) {
+	this.mutex.Lock()
+	if this.closed {
+		this.mutex.Unlock()
+		return
+	}
+	this.closed = true
+	this.closeErr = err
+	this.mutex.Unlock()
+
+	this.cond.Broadcast()
+}
+
+// Read implements io.Reader, blocking until at least one DATA frame has
+// arrived, the peer sent FIN, or the session was closed.
+func (this *Stream) Read(p []byte) (int, error) {
+	this.mutex.Lock()
+	for len(this.recvBuf) == 0 && !this.closed {
+		this.cond.Wait()
+	}
+	if len(this.recvBuf) == 0 && this.closed {
+		err := this.closeErr
+		this.mutex.Unlock()
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, err
+	}
+
+	n := copy(p, this.recvBuf)
+	this.recvBuf = this.recvBuf[n:]
+	this.recvAcked += uint32(n)
+	acked := this.recvAcked
+	if acked >= defaultStreamWindowSize/2 {
+		this.recvAcked = 0
+	}
+	this.mutex.Unlock()
+
+	if acked >= defaultStreamWindowSize/2 {
+		this.session.writeFrame(frameWindowUpdate, this.id, encodeWindowUpdate(acked))
+	}
+
+	return n, nil
+}
+
+// Write implements io.Writer, blocking until the peer's advertised
+// sliding-window has room for the next chunk of @p.
+func (this *Stream) Write(p []byte) (int, error) {
+	total := 0
+	for total < len(p) {
+		this.mutex.Lock()
+		for this.sendWindow == 0 && !this.closed {
+			this.cond.Wait()
+		}
+		if this.closed {
+			err := this.closeErr
+			this.mutex.Unlock()
+			if err == nil {
+				err = io.ErrClosedPipe
+			}
+			return total, err
+		}
+
+		n := len(p) - total
+		if uint32(n) > this.sendWindow {
+			n = int(this.sendWindow)
+		}
+		this.sendWindow -= uint32(n)
+		this.mutex.Unlock()
+
+		if err := this.session.writeFrame(frameDATA, this.id, p[total:total+n]); err != nil {
+			return total, err
+		}
+		total += n
+	}
+
+	return total, nil
+}
+
+// Close sends a FIN frame and releases the stream's slot in its session.
+func (this *Stream) Close() error {
+	this.closeWithError(io.ErrClosedPipe)
+
+	this.session.mutex.Lock()
+	delete(this.session.streams, this.id)
+	this.session.mutex.Unlock()
+
+	return this.session.writeFrame(frameFIN, this.id, nil)
+}
+
+func (this *Stream) LocalAddr() net.Addr  { return this.session.conn.LocalAddr() }
+func (this *Stream) RemoteAddr() net.Addr { return this.session.conn.RemoteAddr() }
+
+// SetDeadline, SetReadDeadline and SetWriteDeadline are not supported: a
+// virtual stream has no socket of its own to apply a deadline to.
+func (this *Stream) SetDeadline(t time.Time) error      { return ErrDeadlineNotSupported }
+func (this *Stream) SetReadDeadline(t time.Time) error  { return ErrDeadlineNotSupported }
+func (this *Stream) SetWriteDeadline(t time.Time) error { return ErrDeadlineNotSupported }
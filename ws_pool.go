@@ -0,0 +1,128 @@
+/******************************************************
+# DESC       : reusable websocket connection pool
+# MAINTAINER : Alex Stocks
+# LICENCE    : Apache License 2.0
+# EMAIL      : alexstocks@foxmail.com
+# MOD        : 2016-10-08 14:37
+# FILE       : ws_pool.go
+******************************************************/
+
+package getty
+
+import (
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// defaultPoolIdleTTL is how long an idle pooled connection may sit before
+	// it is evicted and closed for good.
+	defaultPoolIdleTTL = 180 * time.Second
+)
+
+/////////////////////////////////////////
+// websocket connection pool
+/////////////////////////////////////////
+
+type idleWSConn struct {
+	conn   *wsStreamConn
+	idleAt time.Time
+}
+
+// WSConnPool keeps dialed, reusable *wsStreamConn around, keyed by destination
+// URL, so that short-lived RPCs over websocket don't pay the TLS/WS handshake
+// cost on every call.
+type WSConnPool struct {
+	sync.Mutex
+	dialer  *websocket.Dialer
+	idleTTL time.Duration
+	idle    map[string][]*idleWSConn
+}
+
+// NewWSConnPool creates a WSConnPool. @idleTTL <= 0 means defaultPoolIdleTTL.
+func NewWSConnPool(dialer *websocket.Dialer, idleTTL time.Duration) *WSConnPool {
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	if idleTTL <= 0 {
+		idleTTL = defaultPoolIdleTTL
+	}
+
+	return &WSConnPool{
+		dialer:  dialer,
+		idleTTL: idleTTL,
+		idle:    make(map[string][]*idleWSConn),
+	}
+}
+
+// get pops a live idle connection for @url off the pool, evicting anything
+// that has errored or sat idle longer than idleTTL along the way.
+func (this *WSConnPool) get(url string) *wsStreamConn {
+	this.Lock()
+	defer this.Unlock()
+
+	conns := this.idle[url]
+	now := time.Now()
+	for len(conns) > 0 {
+		ic := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		this.idle[url] = conns
+		if ic.conn.isClosing() || now.Sub(ic.idleAt) > this.idleTTL {
+			ic.conn.reusable = false
+			ic.conn.gettyWSConn.close(0)
+			continue
+		}
+		return ic.conn
+	}
+
+	return nil
+}
+
+// put returns @conn to the idle pool for the URL it was dialed with.
+func (this *WSConnPool) put(conn *wsStreamConn) {
+	this.Lock()
+	defer this.Unlock()
+
+	url := conn.dialURL
+	this.idle[url] = append(this.idle[url], &idleWSConn{conn: conn, idleAt: time.Now()})
+}
+
+// Get dials (or reuses a pooled connection to) @url. When @reusable is true,
+// the returned connection is handed back to the pool instead of being torn
+// down when Close() is called.
+func (this *WSConnPool) Get(url string, header map[string][]string, reusable bool) (*wsStreamConn, error) {
+	if conn := this.get(url); conn != nil {
+		conn.reusable = reusable
+		return conn, nil
+	}
+
+	conn, _, err := this.dialer.Dial(url, header)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := newWSStreamConn(conn)
+	stream.reusable = reusable
+	stream.pool = this
+	stream.dialURL = url
+
+	return stream, nil
+}
+
+// Close evicts and closes every pooled connection.
+func (this *WSConnPool) Close() {
+	this.Lock()
+	defer this.Unlock()
+
+	for url, conns := range this.idle {
+		for _, ic := range conns {
+			ic.conn.reusable = false
+			ic.conn.gettyWSConn.close(0)
+		}
+		delete(this.idle, url)
+	}
+}
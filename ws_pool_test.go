@@ -0,0 +1,82 @@
+/******************************************************
+# DESC       : tests for the reusable websocket connection pool
+# MAINTAINER : Alex Stocks
+# LICENCE    : Apache License 2.0
+# EMAIL      : alexstocks@foxmail.com
+# MOD        : 2016-11-19 10:02
+# FILE       : ws_pool_test.go
+******************************************************/
+
+package getty
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+func newWSTestServer(t *testing.T) (*httptest.Server, string) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+
+	return server, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestWSConnPoolEvictsPastIdleTTL(t *testing.T) {
+	server, wsURL := newWSTestServer(t)
+	defer server.Close()
+
+	pool := NewWSConnPool(nil, 20*time.Millisecond)
+	conn, err := pool.Get(wsURL, nil, true)
+	if err != nil {
+		t.Fatalf("pool.Get(%s) = error:%s", wsURL, err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatalf("conn.Close() = error:%s", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if got := pool.get(wsURL); got != nil {
+		t.Fatalf("pool.get(%s) = %v, want nil once the idle conn is past its TTL", wsURL, got)
+	}
+}
+
+func TestWSConnPoolReusesWithinIdleTTL(t *testing.T) {
+	server, wsURL := newWSTestServer(t)
+	defer server.Close()
+
+	pool := NewWSConnPool(nil, time.Second)
+	conn, err := pool.Get(wsURL, nil, true)
+	if err != nil {
+		t.Fatalf("pool.Get(%s) = error:%s", wsURL, err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatalf("conn.Close() = error:%s", err)
+	}
+
+	got, err := pool.Get(wsURL, nil, true)
+	if err != nil {
+		t.Fatalf("pool.Get(%s) = error:%s", wsURL, err)
+	}
+	if got != conn {
+		t.Fatalf("pool.Get(%s) dialed a new conn instead of reusing the pooled one", wsURL)
+	}
+}
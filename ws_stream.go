@@ -0,0 +1,143 @@
+/******************************************************
+# DESC       : streaming io.Reader/io.Writer adapter for websocket connection
+# MAINTAINER : Alex Stocks
+# LICENCE    : Apache License 2.0
+# EMAIL      : alexstocks@foxmail.com
+# MOD        : 2016-10-08 14:37
+# FILE       : ws_stream.go
+******************************************************/
+
+package getty
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"time"
+)
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+/////////////////////////////////////////
+// websocket stream conn
+/////////////////////////////////////////
+
+// wsStreamConn wraps a gettyWSConn so that it can be used as an io.Reader/io.Writer
+// (net.Conn), letting codecs that expect byte-stream semantics (e.g. length-prefixed
+// protobuf) run over websocket frames instead of one frame per logical packet.
+type wsStreamConn struct {
+	*gettyWSConn
+	reusable bool
+	pool     *WSConnPool
+	dialURL  string // the URL this conn was dialed with, used as the pool key
+	reader   *bufio.Reader
+}
+
+// newWSStreamConn wraps @conn as a streaming net.Conn.
+func newWSStreamConn(conn *websocket.Conn) *wsStreamConn {
+	stream := &wsStreamConn{
+		gettyWSConn: newGettyWSConn(conn),
+	}
+	stream.reader = bufio.NewReader(&frameReader{conn: conn})
+
+	return stream
+}
+
+// Read implements io.Reader on top of the underlying websocket frames. It
+// bypasses gettyWSConn.read, so it must mark the connection as closing itself
+// on error -- otherwise a dead pooled conn would look healthy to WSConnPool.
+func (this *wsStreamConn) Read(p []byte) (int, error) {
+	n, err := this.reader.Read(p)
+	if n > 0 {
+		this.updateActive()
+	}
+	if err != nil && !isTemporary(err) {
+		this.setClosing()
+	}
+
+	return n, err
+}
+
+// Write implements io.Writer. It opens a binary message writer for every call so
+// that large payloads can be streamed out without being fully buffered first.
+// Like Read, it bypasses gettyWSConn.write and so marks closing itself on error.
+func (this *wsStreamConn) Write(p []byte) (int, error) {
+	w, err := this.conn.NextWriter(websocket.BinaryMessage)
+	if err != nil {
+		this.setClosing()
+		return 0, err
+	}
+	n, err := w.Write(p)
+	if err != nil {
+		w.Close()
+		this.setClosing()
+		return n, err
+	}
+	if err = w.Close(); err != nil {
+		this.setClosing()
+		return n, err
+	}
+	this.updateActive()
+
+	return n, nil
+}
+
+func (this *wsStreamConn) LocalAddr() net.Addr  { return this.conn.LocalAddr() }
+func (this *wsStreamConn) RemoteAddr() net.Addr { return this.conn.RemoteAddr() }
+
+func (this *wsStreamConn) SetDeadline(t time.Time) error {
+	if err := this.conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return this.conn.SetWriteDeadline(t)
+}
+
+func (this *wsStreamConn) SetReadDeadline(t time.Time) error  { return this.conn.SetReadDeadline(t) }
+func (this *wsStreamConn) SetWriteDeadline(t time.Time) error { return this.conn.SetWriteDeadline(t) }
+
+// Close releases the underlying websocket connection, handing it back to the
+// pool instead of tearing it down when @reusable was set at dial time -- but
+// only when the conn hasn't errored, since a conn that failed mid-stream is
+// not safe to hand to the next caller.
+func (this *wsStreamConn) Close() error {
+	if this.reusable && this.pool != nil && !this.isClosing() {
+		this.pool.put(this)
+		return nil
+	}
+
+	this.gettyWSConn.close(0)
+	return nil
+}
+
+// frameReader adapts a sequence of websocket frames (via NextReader) to a single
+// io.Reader, transparently refilling from a new frame once the current one is
+// drained so that a logical packet may span multiple frames.
+type frameReader struct {
+	conn    *websocket.Conn
+	current io.Reader
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			_, fr, err := r.conn.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			r.current = fr
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+
+		return n, err
+	}
+}
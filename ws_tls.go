@@ -0,0 +1,141 @@
+/******************************************************
+# DESC       : pluggable TLS and dialer configuration for websocket connections
+# MAINTAINER : Alex Stocks
+# LICENCE    : Apache License 2.0
+# EMAIL      : alexstocks@foxmail.com
+# MOD        : 2016-10-22 09:48
+# FILE       : ws_tls.go
+******************************************************/
+
+package getty
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+/////////////////////////////////////////
+// websocket TLS config
+/////////////////////////////////////////
+
+// WSTLSConfig holds the file paths needed to build a *tls.Config for either
+// end of a wss:// connection: @CertFile/@PrivKeyFile are this side's own
+// identity, @CARootCertFile is the PEM bundle used to verify the peer (the
+// server's cert when dialing, or client certs when requiring mTLS).
+type WSTLSConfig struct {
+	CertFile       string
+	PrivKeyFile    string
+	CARootCertFile string
+}
+
+// buildTLSConfig loads the configured cert/key/CA files into a *tls.Config.
+func (c *WSTLSConfig) buildTLSConfig(isServer bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if c.CertFile != "" && c.PrivKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.PrivKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls.LoadX509KeyPair(cert:%s, key:%s) = error:%s", c.CertFile, c.PrivKeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if c.CARootCertFile != "" {
+		ca, err := ioutil.ReadFile(c.CARootCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("ioutil.ReadFile(%s) = error:%s", c.CARootCertFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("failed to parse CA root cert %s", c.CARootCertFile)
+		}
+		if isServer {
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			tlsConfig.RootCAs = pool
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+/////////////////////////////////////////
+// websocket config
+/////////////////////////////////////////
+
+// WSConfig gathers everything needed to dial or accept a websocket connection
+// that may additionally require TLS: the upgrade @Path, the list of
+// @Subprotocols to negotiate, optional @TLSConfig for wss://, extra
+// @HTTPHeader to send during the handshake and a @HandshakeTimeout.
+// newGettyWSSConn dials @wsURL as given and newWSUpgrader does not read @Path,
+// so @Path is not applied by either; @HTTPHeader is only sent when dialing.
+type WSConfig struct {
+	Path             string
+	Subprotocols     []string
+	TLSConfig        *WSTLSConfig
+	HTTPHeader       http.Header
+	HandshakeTimeout time.Duration
+}
+
+// newGettyWSSConn dials @wsURL (ws:// or wss://) according to @config and
+// wraps the resulting connection as a *gettyWSConn. When @config.TLSConfig is
+// set, the dialer is configured with a *tls.Config built from the referenced
+// cert/key/CA files so that wss:// and mTLS-authenticated clients work.
+func newGettyWSSConn(wsURL string, config *WSConfig) (*gettyWSConn, error) {
+	if config == nil {
+		config = &WSConfig{}
+	}
+
+	dialer := &websocket.Dialer{
+		Subprotocols:     config.Subprotocols,
+		HandshakeTimeout: config.HandshakeTimeout,
+	}
+	if config.TLSConfig != nil {
+		tlsConfig, err := config.TLSConfig.buildTLSConfig(false)
+		if err != nil {
+			return nil, err
+		}
+		dialer.TLSClientConfig = tlsConfig
+	}
+
+	conn, _, err := dialer.Dial(wsURL, config.HTTPHeader)
+	if err != nil {
+		return nil, fmt.Errorf("websocket.Dialer.Dial(url:%s) = error:%s", wsURL, err)
+	}
+
+	return newGettyWSConn(conn), nil
+}
+
+// newWSUpgrader builds a server-side websocket.Upgrader that negotiates the
+// subprotocols configured in @config.
+func newWSUpgrader(config *WSConfig) *websocket.Upgrader {
+	if config == nil {
+		config = &WSConfig{}
+	}
+
+	return &websocket.Upgrader{
+		HandshakeTimeout: config.HandshakeTimeout,
+		Subprotocols:     config.Subprotocols,
+	}
+}
+
+// newWSSTLSConfig builds the *tls.Config an https.Server should be started
+// with in order to serve wss:// upgrades, reading the server's own
+// cert/key and, when @config.TLSConfig.CARootCertFile is set, requiring and
+// verifying client certificates for mTLS.
+func newWSSTLSConfig(config *WSConfig) (*tls.Config, error) {
+	if config == nil || config.TLSConfig == nil {
+		return nil, fmt.Errorf("newWSSTLSConfig: @config.TLSConfig is nil")
+	}
+
+	return config.TLSConfig.buildTLSConfig(true)
+}